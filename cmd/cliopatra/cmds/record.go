@@ -0,0 +1,62 @@
+package cmds
+
+import (
+	"context"
+	"os"
+
+	"github.com/go-go-golems/cliopatra/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// NewRecordCommand returns the `cliopatra record -- <cmd> <args...>` command,
+// which runs the given command and prints the Program YAML recorded from it.
+func NewRecordCommand() *cobra.Command {
+	var name string
+	var outputDirectory string
+	var outputFile string
+
+	cmd := &cobra.Command{
+		Use:   "record -- <cmd> [args...]",
+		Short: "Run a command and record it as a Program YAML",
+		Long: "Runs the given command, capturing its argv, stdin, stdout, stderr and exit code into " +
+			"a Program, and prints it as YAML, ready to be added to a repository and re-run by `cliopatra test`.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := pkg.RecordOptions{
+				Name:            name,
+				OutputDirectory: outputDirectory,
+			}
+
+			program, err := pkg.RecordProgram(context.Background(), args, opts)
+			if err != nil {
+				return errors.Wrap(err, "could not record program")
+			}
+
+			out, err := yaml.Marshal(program)
+			if err != nil {
+				return errors.Wrap(err, "could not marshal recorded program")
+			}
+
+			if outputFile != "" {
+				if err := os.WriteFile(outputFile, out, 0644); err != nil {
+					return errors.Wrapf(err, "could not write recorded program to %s", outputFile)
+				}
+				return nil
+			}
+
+			_, err = cmd.OutOrStdout().Write(out)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "",
+		"Name to give the recorded Program (defaults to the executable's base name)")
+	cmd.Flags().StringVar(&outputDirectory, "output-dir", "",
+		"Directory to snapshot as ExpectedFiles after the command runs")
+	cmd.Flags().StringVar(&outputFile, "output-file", "",
+		"Write the recorded Program YAML to this file instead of stdout")
+
+	return cmd
+}
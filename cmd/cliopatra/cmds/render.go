@@ -16,9 +16,77 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
-func runWatcher(args []string) {
+// watchDebounce is the minimum amount of time that has to pass between two
+// renders of the same file before a fs event for it is acted upon again.
+const watchDebounce = 200 * time.Millisecond
+
+// tmplMdSuffix to outputSuffix mapping applied by renderChangedPath to the
+// output path of a single re-rendered file.
+const (
+	tmplMdSuffix = ".tmpl.md"
+	outputSuffix = ".md"
+)
+
+// renderChangedPath renders the file (or, if it lives under one of the
+// watched input directories, that whole directory) that triggered path,
+// writing the result under outputDirectory (or to outputFile, if set and a
+// single file is being watched).
+func renderChangedPath(renderer *render.Renderer, path string, files []string, outputDirectory string, outputFile string) error {
+	basePath := path
+	isDir := false
+	for _, file := range files {
+		if strings.HasPrefix(path, file) {
+			basePath = file
+			if fi, err := os.Stat(file); err == nil && fi.IsDir() {
+				isDir = true
+			}
+			break
+		}
+	}
+
+	if isDir {
+		log.Info().Str("path", path).Str("basePath", basePath).Msg("File changed, re-rendering directory")
+		return renderer.RenderDirectory(basePath, outputDirectory)
+	}
+
+	var outputPath string
+	if outputFile != "" && len(files) == 1 {
+		outputPath = outputFile
+	} else if basePath == path {
+		// path is itself one of the watched files rather than a path under a
+		// watched directory, so there is no relative path to preserve.
+		outputPath = filepath.Join(outputDirectory, filepath.Base(path))
+	} else {
+		relPath := strings.TrimPrefix(strings.TrimPrefix(path, basePath), "/")
+		outputPath = filepath.Join(outputDirectory, relPath)
+	}
+
+	if strings.HasSuffix(outputPath, tmplMdSuffix) {
+		outputPath = strings.TrimSuffix(outputPath, tmplMdSuffix) + outputSuffix
+	}
+
+	log.Info().
+		Str("path", path).
+		Str("basePath", basePath).
+		Str("outputPath", outputPath).
+		Msg("File changed, re-rendering")
+
+	return renderer.RenderFile(path, outputPath)
+}
+
+// isUnderRepository returns true if path lives under one of the given
+// repository directories.
+func isUnderRepository(path string, repositories []string) bool {
+	for _, repository := range repositories {
+		if strings.HasPrefix(path, repository) {
+			return true
+		}
+	}
+	return false
 }
 
 type renderCommandSettings struct {
@@ -129,7 +197,8 @@ func NewRenderCommand() *cobra.Command {
 		cobra.CheckErr(err)
 
 		repositories := ps["repository"]
-		programs := pkg.LoadRepositories(repositories.([]string))
+		programs, err := pkg.LoadRepositories(repositories.([]string))
+		cobra.CheckErr(err)
 
 		files, ok := ps["files"]
 		if !ok {
@@ -140,8 +209,9 @@ func NewRenderCommand() *cobra.Command {
 			cobra.CheckErr(errors.New("files parameter is not a string list"))
 		}
 
+		watchedPaths := append(append([]string{}, files_...), settings.Repository...)
 		watcherOptions := []watcher.Option{
-			watcher.WithPaths(files_...),
+			watcher.WithPaths(watchedPaths...),
 		}
 
 		if settings.Glob != nil && len(settings.Glob) > 0 {
@@ -185,23 +255,34 @@ func NewRenderCommand() *cobra.Command {
 				cobra.CheckErr(errors.New("output-directory parameter is empty"))
 			}
 
+			var mu sync.Mutex
+			lastEvent := map[string]time.Time{}
+
 			w := watcher.NewWatcher(func(path string) error {
-				log.Info().Str("path", path).Msg("File changed")
-				// get the base path
-				basePath := path
-				for _, file := range files_ {
-					if strings.HasPrefix(path, file) {
-						basePath = file
-						break
+				mu.Lock()
+				now := time.Now()
+				if last, ok := lastEvent[path]; ok && now.Sub(last) < watchDebounce {
+					mu.Unlock()
+					return nil
+				}
+				lastEvent[path] = now
+				mu.Unlock()
+
+				if (strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")) &&
+					isUnderRepository(path, settings.Repository) {
+					log.Info().Str("path", path).Msg("Repository file changed, reloading programs")
+					reloaded, err := pkg.LoadRepositories(settings.Repository)
+					if err != nil {
+						log.Error().Err(err).Str("path", path).Msg("Could not reload repositories")
+						return nil
 					}
+					renderer.SetPrograms(reloaded)
+					return nil
 				}
 
-				outputPath := filepath.Join(outputDirectory, strings.TrimPrefix(path, basePath))
-				log.Info().
-					Str("path", path).
-					Str("basePath", basePath).
-					Str("outputPath", outputPath).
-					Msg("File changed")
+				if err := renderChangedPath(renderer, path, files_, settings.OutputDirectory, settings.OutputFile); err != nil {
+					log.Error().Err(err).Str("path", path).Msg("Could not render changed file")
+				}
 
 				return nil
 			},
@@ -215,14 +296,13 @@ func NewRenderCommand() *cobra.Command {
 				return w.Run(ctx)
 			})
 
-			err := eg.Wait()
+			err = eg.Wait()
 			// check that the error wasn't a cancel
 			if err != nil && err != context.Canceled {
 				log.Error().Err(err).Msg("Error running watcher")
 			}
 			cobra.CheckErr(err)
 
-			runWatcher(files.([]string))
 			return
 		}
 
@@ -0,0 +1,43 @@
+package cmds
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/cliopatra/pkg/render"
+)
+
+func TestIsUnderRepository(t *testing.T) {
+	repositories := []string{"/repo/a", "/repo/b"}
+
+	if !isUnderRepository("/repo/a/programs/foo.yaml", repositories) {
+		t.Fatal("expected a path under /repo/a to be recognized as under a repository")
+	}
+	if isUnderRepository("/other/foo.yaml", repositories) {
+		t.Fatal("expected a path outside every repository to not be recognized as under a repository")
+	}
+}
+
+func TestRenderChangedPathSingleFileKeepsBasename(t *testing.T) {
+	dir := t.TempDir()
+	outputDir := t.TempDir()
+
+	src := filepath.Join(dir, "note.tmpl.md")
+	if err := os.WriteFile(src, []byte("hello"), 0644); err != nil {
+		t.Fatalf("could not write source file: %v", err)
+	}
+
+	renderer := render.NewRenderer()
+
+	// A single watched file (not a directory) with no --output-file set
+	// must render to outputDir/<basename>, not collapse to outputDir itself.
+	if err := renderChangedPath(renderer, src, []string{src}, outputDir, ""); err != nil {
+		t.Fatalf("renderChangedPath returned error: %v", err)
+	}
+
+	expectedOutput := filepath.Join(outputDir, "note.md")
+	if _, err := os.Stat(expectedOutput); err != nil {
+		t.Fatalf("expected rendered output at %s: %v", expectedOutput, err)
+	}
+}
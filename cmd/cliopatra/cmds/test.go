@@ -0,0 +1,262 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-go-golems/cliopatra/pkg"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/layers"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+)
+
+// TestCommand discovers Program YAML across one or more repositories and
+// runs each of them through pkg.RunProgramAsTest, emitting one glazed row
+// per program so the results can be rendered as a table, JSON, or any other
+// glazed output format.
+type TestCommand struct {
+	*cmds.CommandDescription
+}
+
+type testCommandSettings struct {
+	Repository []string `glazed.parameter:"repository"`
+	Jobs       int      `glazed.parameter:"jobs"`
+	Update     bool     `glazed.parameter:"update"`
+	Diff       bool     `glazed.parameter:"diff"`
+}
+
+func NewTestCommand() (*TestCommand, error) {
+	glazedLayer, err := settings.NewGlazedParameterLayers()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed parameter layer")
+	}
+
+	description := cmds.NewCommandDescription("test",
+		cmds.WithShort("Run Program YAML files as golden tests"),
+		cmds.WithLong("Discover Program YAML across one or more repositories and compare their actual "+
+			"output against the Expected* fields, reporting pass/fail per program."),
+		cmds.WithFlags(
+			parameters.NewParameterDefinition(
+				"repository",
+				parameters.ParameterTypeStringList,
+				parameters.WithHelp("List of repositories to discover Program YAML in"),
+				parameters.WithRequired(true),
+			),
+			parameters.NewParameterDefinition(
+				"jobs",
+				parameters.ParameterTypeInteger,
+				parameters.WithHelp("Number of programs to run in parallel"),
+				parameters.WithShortFlag("j"),
+				parameters.WithDefault(1),
+			),
+			parameters.NewParameterDefinition(
+				"update",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Rewrite the Expected* fields of failing programs with the observed output"),
+				parameters.WithDefault(false),
+			),
+			parameters.NewParameterDefinition(
+				"diff",
+				parameters.ParameterTypeBool,
+				parameters.WithHelp("Render a unified diff for mismatching stdout/stderr/files"),
+				parameters.WithDefault(true),
+			),
+		),
+		cmds.WithLayers(glazedLayer),
+	)
+
+	return &TestCommand{CommandDescription: description}, nil
+}
+
+type programWithPath struct {
+	path    string
+	program *pkg.Program
+}
+
+// loadProgramsWithPaths walks repositories the same way pkg.LoadProgramsFromFS
+// does, but keeps track of the source file of each Program so that --update
+// knows where to write the rewritten YAML back to.
+func loadProgramsWithPaths(repositories []string) ([]programWithPath, error) {
+	var result []programWithPath
+
+	for _, repository := range repositories {
+		err := filepath.WalkDir(repository, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != repository && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || (!strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml")) {
+				return nil
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return errors.Wrapf(err, "could not open file %s", path)
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+
+			program, err := pkg.NewProgramFromYAML(f)
+			if err != nil {
+				return errors.Wrapf(err, "could not load program from file %s", path)
+			}
+
+			result = append(result, programWithPath{path: path, program: program})
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not walk repository %s", repository)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *TestCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	gp middlewares.Processor,
+) error {
+	s := &testCommandSettings{}
+	err := parameters.InitializeStructFromParameters(s, ps)
+	if err != nil {
+		return err
+	}
+
+	programs, err := loadProgramsWithPaths(s.Repository)
+	if err != nil {
+		return err
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(s.Jobs)
+
+	runner := pkg.NewRunner()
+
+	results := make([]*pkg.TestResult, len(programs))
+	for i, p := range programs {
+		i, p := i, p
+		eg.Go(func() error {
+			result, err := pkg.RunProgramAsTest(ctx, runner, p.program, nil)
+			if err != nil {
+				return errors.Wrapf(err, "could not run program %s", p.program.Name)
+			}
+			results[i] = result
+
+			if s.Update && !result.Passed {
+				if err := updateProgramExpectations(p, result); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if !s.Diff {
+			result.StdoutDiff = ""
+			result.StderrDiff = ""
+			for i := range result.Files {
+				result.Files[i].Diff = ""
+			}
+		}
+
+		row := types.NewRow(
+			types.MRP("name", result.Name),
+			types.MRP("passed", result.Passed),
+			types.MRP("statusCode", result.StatusCode),
+			types.MRP("stdoutDiff", result.StdoutDiff),
+			types.MRP("stderrDiff", result.StderrDiff),
+			types.MRP("filesDiff", renderFilesDiff(result.Files)),
+			types.MRP("error", result.Error),
+		)
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renderFilesDiff renders the failing entries of files as a single string,
+// one "--- path ---" block per mismatching file, so a file mismatch is
+// actionable from the glazed row alone instead of only flipping Passed.
+func renderFilesDiff(files []pkg.FileTestResult) string {
+	var blocks []string
+	for _, f := range files {
+		if f.Passed {
+			continue
+		}
+		if f.Error != "" {
+			blocks = append(blocks, fmt.Sprintf("--- %s ---\n%s", f.Path, f.Error))
+			continue
+		}
+		blocks = append(blocks, fmt.Sprintf("--- %s ---\n%s", f.Path, f.Diff))
+	}
+	return strings.Join(blocks, "\n")
+}
+
+func updateProgramExpectations(p programWithPath, result *pkg.TestResult) error {
+	p.program.ExpectedStdout = result.Stdout
+	p.program.ExpectedError = result.Stderr
+	p.program.ExpectedStatusCode = result.StatusCode
+
+	for _, f := range result.Files {
+		if f.Error != "" {
+			// The file couldn't be read back; leave the existing expectation
+			// alone rather than overwriting it with nothing.
+			continue
+		}
+		if p.program.ExpectedFiles == nil {
+			p.program.ExpectedFiles = map[string]string{}
+		}
+		p.program.ExpectedFiles[f.Path] = f.Actual
+	}
+
+	out, err := yaml.Marshal(p.program)
+	if err != nil {
+		return errors.Wrapf(err, "could not marshal updated program %s", p.program.Name)
+	}
+
+	if err := os.WriteFile(p.path, out, 0644); err != nil {
+		return errors.Wrapf(err, "could not write updated program %s", p.path)
+	}
+
+	log.Info().Str("path", p.path).Str("name", p.program.Name).Msg("Updated program expectations")
+	return nil
+}
+
+func NewTestCobraCommand() *cobra.Command {
+	testCommand, err := NewTestCommand()
+	cobra.CheckErr(err)
+
+	cobraCommand, err := cli.BuildCobraCommandFromGlazeCommand(testCommand)
+	cobra.CheckErr(err)
+
+	return cobraCommand
+}
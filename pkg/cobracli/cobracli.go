@@ -0,0 +1,273 @@
+// Package cobracli turns a map of loaded cliopatra Programs (as returned by
+// pkg.LoadRepositories) into a cobra.Command tree, so that a plain
+// repository of Program YAML can be run as a working multi-command CLI
+// without writing any Go code.
+package cobracli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-go-golems/cliopatra/pkg"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Option configures the command tree built by BuildCommand.
+type Option func(*options)
+
+type options struct {
+	envPrefix string
+}
+
+// WithEnvPrefix overrides the default "CLIOPATRA" prefix used to derive
+// per-flag environment variable names (CLIOPATRA_<PROG>_<FLAG>).
+func WithEnvPrefix(prefix string) Option {
+	return func(o *options) {
+		o.envPrefix = prefix
+	}
+}
+
+// BuildCommand walks programs and returns a root *cobra.Command with one
+// subcommand per Program. A Program's Verbs are used to derive the path of
+// intermediate subcommands it is nested under (so a Program named "build"
+// with Verbs ["image"] ends up reachable as "<root> image build"), and its
+// Flags and Args become typed pflag flags and positionals respectively.
+func BuildCommand(programs map[string]*pkg.Program, opts ...Option) (*cobra.Command, error) {
+	o := &options{envPrefix: "CLIOPATRA"}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	root := &cobra.Command{
+		Use:   "cliopatra",
+		Short: "Dynamically generated CLI for the programs in this repository",
+	}
+	root.PersistentFlags().Bool("dry-run", false, "Print the assembled argv instead of executing the program")
+
+	for name, program := range programs {
+		cmd, err := buildProgramCommand(program, o)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not build command for program %s", name)
+		}
+
+		parent := root
+		for _, verb := range program.Verbs {
+			parent = ensureVerbCommand(parent, verb)
+		}
+		parent.AddCommand(cmd)
+	}
+
+	return root, nil
+}
+
+// ensureVerbCommand returns the child of parent named verb, creating a bare
+// grouping command for it if it doesn't exist yet.
+func ensureVerbCommand(parent *cobra.Command, verb string) *cobra.Command {
+	for _, c := range parent.Commands() {
+		if c.Use == verb {
+			return c
+		}
+	}
+
+	c := &cobra.Command{
+		Use:   verb,
+		Short: fmt.Sprintf("%s commands", verb),
+	}
+	parent.AddCommand(c)
+	return c
+}
+
+// flagBinding ties a registered pflag to the Program.Flags or Program.Args
+// entry it was created for, so RunE can pull out its parsed value.
+type flagBinding struct {
+	name     string
+	flagType parameters.ParameterType
+	getValue func() interface{}
+}
+
+func buildProgramCommand(program *pkg.Program, o *options) (*cobra.Command, error) {
+	cmd := &cobra.Command{
+		Use:   program.Name,
+		Short: program.Description,
+		Args:  cobra.ExactArgs(len(program.Args)),
+	}
+
+	v := viper.New()
+	v.SetEnvPrefix(strings.ToUpper(o.envPrefix + "_" + program.Name))
+	v.AutomaticEnv()
+
+	bindings := make([]*flagBinding, 0, len(program.Flags))
+	for _, flag := range program.Flags {
+		binding, err := registerFlag(cmd, flag)
+		if err != nil {
+			return nil, err
+		}
+		if err := v.BindPFlag(binding.name, cmd.Flags().Lookup(binding.name)); err != nil {
+			return nil, errors.Wrapf(err, "could not bind env var for flag %s", binding.name)
+		}
+		bindings = append(bindings, binding)
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ps := map[string]interface{}{}
+
+		for _, binding := range bindings {
+			if cmd.Flags().Changed(binding.name) {
+				ps[binding.name] = binding.getValue()
+			} else {
+				ps[binding.name] = getTypedEnvValue(v, binding.name, binding.flagType)
+			}
+		}
+
+		for i, arg := range program.Args {
+			value, err := parseValue(arg.Type, args[i])
+			if err != nil {
+				return errors.Wrapf(err, "could not parse argument %s", arg.Name)
+			}
+			ps[arg.Name] = value
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		argv, err := program.ComputeArgs(ps)
+		if err != nil {
+			return errors.Wrap(err, "could not compute argv")
+		}
+
+		if dryRun {
+			fmt.Fprintln(cmd.OutOrStdout(), commandLine(append([]string{program.Name}, argv...)))
+			return nil
+		}
+
+		return program.RunIntoWriter(context.Background(), nil, ps, cmd.OutOrStdout())
+	}
+
+	return cmd, nil
+}
+
+// commandLine joins tokens into a single shell-quoted command line, so
+// --dry-run prints something that can be copy-pasted and re-run rather than
+// Go's bracketed %v slice representation.
+func commandLine(tokens []string) string {
+	quoted := make([]string, len(tokens))
+	for i, token := range tokens {
+		quoted[i] = shellQuote(token)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote wraps token in single quotes if it contains characters a shell
+// would otherwise treat specially, escaping any single quotes it contains.
+func shellQuote(token string) string {
+	if token != "" && !strings.ContainsAny(token, " \t\n'\"\\$`|&;<>()[]{}*?!~#") {
+		return token
+	}
+	return "'" + strings.ReplaceAll(token, "'", `'\''`) + "'"
+}
+
+// registerFlag installs flag as a typed pflag on cmd, picking the
+// appropriate *Var constructor based on flag.Type.
+func registerFlag(cmd *cobra.Command, flag *pkg.Parameter) (*flagBinding, error) {
+	name := flag.Name
+
+	switch flag.Type {
+	case parameters.ParameterTypeString:
+		def, _ := flag.Value.(string)
+		v := cmd.Flags().String(name, def, flag.Short)
+		return &flagBinding{name: name, flagType: flag.Type, getValue: func() interface{} { return *v }}, nil
+
+	case parameters.ParameterTypeChoice:
+		// pkg.Parameter doesn't carry a list of allowed values, so there is
+		// nothing to validate against here yet. Reject rather than silently
+		// accepting any string, until Parameter grows a Choices field.
+		return nil, fmt.Errorf("flag %s: ParameterTypeChoice is not supported by cobracli yet (Parameter has no choices to validate against)", name)
+
+	case parameters.ParameterTypeInteger:
+		def, _ := flag.Value.(int)
+		v := cmd.Flags().Int(name, def, flag.Short)
+		return &flagBinding{name: name, flagType: flag.Type, getValue: func() interface{} { return *v }}, nil
+
+	case parameters.ParameterTypeFloat:
+		def, _ := flag.Value.(float64)
+		v := cmd.Flags().Float64(name, def, flag.Short)
+		return &flagBinding{name: name, flagType: flag.Type, getValue: func() interface{} { return *v }}, nil
+
+	case parameters.ParameterTypeBool:
+		def, _ := flag.Value.(bool)
+		v := cmd.Flags().Bool(name, def, flag.Short)
+		return &flagBinding{name: name, flagType: flag.Type, getValue: func() interface{} { return *v }}, nil
+
+	case parameters.ParameterTypeStringList:
+		def := toStringSlice(flag.Value)
+		v := cmd.Flags().StringSlice(name, def, flag.Short)
+		return &flagBinding{name: name, flagType: flag.Type, getValue: func() interface{} { return *v }}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported flag type %s for flag %s", flag.Type, name)
+	}
+}
+
+// getTypedEnvValue reads the value viper bound for name using the getter
+// that matches flagType, instead of the untyped v.Get, which returns a
+// string for env vars and would otherwise hand parameters.RenderValue a
+// string where it expects an int, bool, float64 or []string.
+func getTypedEnvValue(v *viper.Viper, name string, flagType parameters.ParameterType) interface{} {
+	switch flagType {
+	case parameters.ParameterTypeInteger:
+		return v.GetInt(name)
+	case parameters.ParameterTypeFloat:
+		return v.GetFloat64(name)
+	case parameters.ParameterTypeBool:
+		return v.GetBool(name)
+	case parameters.ParameterTypeStringList:
+		return v.GetStringSlice(name)
+	default:
+		return v.GetString(name)
+	}
+}
+
+// toStringSlice coerces a Parameter.Value default into a []string. YAML
+// sequences decode into []interface{} rather than []string, so a plain
+// type assertion against []string silently drops StringList defaults that
+// came from Program YAML.
+func toStringSlice(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, len(v))
+		for i, item := range v {
+			result[i] = fmt.Sprintf("%v", item)
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// parseValue converts a raw positional argument string into the Go type
+// parameters.RenderValue expects for t, mirroring the subset of
+// parameters.ParameterType that registerFlag supports. Unlike registerFlag,
+// it also accepts ParameterTypeChoice, passing the raw string through
+// without validation.
+func parseValue(t parameters.ParameterType, raw string) (interface{}, error) {
+	switch t {
+	case parameters.ParameterTypeString, parameters.ParameterTypeChoice:
+		return raw, nil
+	case parameters.ParameterTypeInteger:
+		return strconv.Atoi(raw)
+	case parameters.ParameterTypeFloat:
+		return strconv.ParseFloat(raw, 64)
+	case parameters.ParameterTypeBool:
+		return strconv.ParseBool(raw)
+	case parameters.ParameterTypeStringList:
+		return strings.Split(raw, ","), nil
+	default:
+		return nil, fmt.Errorf("unsupported argument type %s", t)
+	}
+}
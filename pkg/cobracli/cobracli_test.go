@@ -0,0 +1,105 @@
+package cobracli
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/cliopatra/pkg"
+	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
+)
+
+func runDryRun(t *testing.T, program *pkg.Program, args ...string) string {
+	t.Helper()
+
+	root, err := BuildCommand(map[string]*pkg.Program{program.Name: program})
+	if err != nil {
+		t.Fatalf("BuildCommand returned error: %v", err)
+	}
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetArgs(append([]string{program.Name, "--dry-run"}, args...))
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("root.Execute returned error: %v", err)
+	}
+
+	return strings.TrimSpace(out.String())
+}
+
+func TestBuildCommandDryRunQuotesArgv(t *testing.T) {
+	program := &pkg.Program{
+		Name: "greet",
+		Path: "/bin/echo",
+		Flags: []*pkg.Parameter{
+			{Name: "message", Type: parameters.ParameterTypeString, Flag: "--message"},
+		},
+	}
+
+	out := runDryRun(t, program, "--message", "hello world")
+
+	if !strings.Contains(out, "'hello world'") {
+		t.Fatalf("expected dry-run output to quote the flag value, got %q", out)
+	}
+	if strings.Contains(out, "[") || strings.Contains(out, "]") {
+		t.Fatalf("expected a shell command line, not a Go slice representation, got %q", out)
+	}
+}
+
+func TestBuildCommandRejectsChoiceFlag(t *testing.T) {
+	program := &pkg.Program{
+		Name: "pick",
+		Path: "/bin/echo",
+		Flags: []*pkg.Parameter{
+			{Name: "color", Type: parameters.ParameterTypeChoice, Flag: "--color"},
+		},
+	}
+
+	_, err := BuildCommand(map[string]*pkg.Program{program.Name: program})
+	if err == nil {
+		t.Fatal("expected BuildCommand to reject a ParameterTypeChoice flag")
+	}
+}
+
+func TestRegisterFlagStringListAcceptsYamlDecodedDefault(t *testing.T) {
+	program := &pkg.Program{
+		Name: "tags",
+		Path: "/bin/echo",
+		Flags: []*pkg.Parameter{
+			// Simulates how gopkg.in/yaml.v3 decodes a YAML sequence into an
+			// interface{}-typed field: []interface{}, not []string.
+			{Name: "tag", Type: parameters.ParameterTypeStringList, Flag: "--tag", Value: []interface{}{"a", "b"}},
+		},
+	}
+
+	out := runDryRun(t, program)
+
+	if !strings.Contains(out, "--tag") || !strings.Contains(out, "a") || !strings.Contains(out, "b") {
+		t.Fatalf("expected the YAML-decoded StringList default to survive into argv, got %q", out)
+	}
+}
+
+func TestRunEUsesTypedEnvValueForIntegerFlag(t *testing.T) {
+	program := &pkg.Program{
+		Name: "count",
+		Path: "/bin/echo",
+		Flags: []*pkg.Parameter{
+			{Name: "n", Type: parameters.ParameterTypeInteger, Flag: "--n"},
+		},
+	}
+
+	envVar := "CLIOPATRA_COUNT_N"
+	if err := os.Setenv(envVar, "42"); err != nil {
+		t.Fatalf("could not set env var: %v", err)
+	}
+	defer func() { _ = os.Unsetenv(envVar) }()
+
+	out := runDryRun(t, program)
+
+	if !strings.Contains(out, "--n 42") {
+		t.Fatalf("expected the env var to be coerced to an int and rendered as --n 42, got %q", out)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/layers"
 	"github.com/go-go-golems/glazed/pkg/cmds/parameters"
 	"github.com/pkg/errors"
+	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
 	"io"
 	"io/fs"
@@ -32,7 +33,6 @@ type Parameter struct {
 	NoValue bool                     `yaml:"noValue,omitempty"`
 }
 
-// NOTE(manuel, 2023-03-16) What about sandboxing the execution of the command, especially if it outputs files
 // NOTE(manuel, 2023-03-16) It would be interesting to provide some more tests on the output (say, as shell scripts)
 // NOTE(manuel, 2023-03-16) What about measuring profiling regression
 
@@ -48,6 +48,28 @@ func (p *Parameter) Clone() *Parameter {
 	}
 }
 
+// Sandbox describes an isolated working directory to run a Program in.
+// When set on a Program, RunIntoWriter creates a fresh temporary directory,
+// materializes InputFiles and Mounts into it, runs the program with that
+// directory as its working directory, and restricts the child process'
+// environment to the variables named in Env.
+type Sandbox struct {
+	// Workdir, if set, is used as the name prefix of the temporary directory
+	// created for the run (see afero.TempDir): a random suffix is appended to
+	// it, and a "*" in it is not replaced the way os.MkdirTemp's pattern is.
+	Workdir string `yaml:"workdir,omitempty"`
+	// InputFiles maps a path relative to the sandbox working directory to the
+	// content that should be written there before the program runs.
+	InputFiles map[string]string `yaml:"inputFiles,omitempty"`
+	// Mounts maps a path relative to the sandbox working directory to a path
+	// on the host filesystem whose content is copied in before the run.
+	Mounts map[string]string `yaml:"mounts,omitempty"`
+	// Env is the allowlist of host environment variable names that are
+	// passed through to the sandboxed process. Program.Env is always applied
+	// on top, regardless of this allowlist.
+	Env []string `yaml:"env,omitempty"`
+}
+
 // Program describes a program to be executed by cliopatra.
 //
 // This can be used for golden tests by providing the
@@ -59,9 +81,9 @@ type Program struct {
 	// Env makes it possible to specify environment variables to set manually
 	Env map[string]string `yaml:"env,omitempty"`
 
-	// TODO(manuel, 2023-03-16) Probably add RawFlags here, when we say quickly want to record a run.
-	// Of course, if we are using Command, we could have that render a more precisely described
-	// cliopatra file. But just capturing normal calls is nice too.
+	// RawFlags holds everything of an invocation that wasn't parsed into Verbs,
+	// Flags or Args. This is mostly populated by RecordProgram, which captures
+	// a plain invocation of a tool as-is rather than describing it precisely.
 	RawFlags []string `yaml:"rawFlags,omitempty"`
 
 	// These Flags will be passed to the CLI tool. This allows us to register
@@ -72,6 +94,10 @@ type Program struct {
 	// Stdin makes it possible to pass data into stdin. If empty, no data is passed.
 	Stdin string `yaml:"stdin,omitempty"`
 
+	// Sandbox, if set, causes RunIntoWriter to execute the program in an
+	// isolated working directory instead of the host's current directory.
+	Sandbox *Sandbox `yaml:"sandbox,omitempty"`
+
 	// These fields are useful for golden testing.
 	ExpectedStdout     string            `yaml:"expectedStdout,omitempty"`
 	ExpectedError      string            `yaml:"expectedError,omitempty"`
@@ -161,29 +187,95 @@ func (p *Program) AddRawFlag(raw ...string) {
 	p.RawFlags = append(p.RawFlags, raw...)
 }
 
-func (p *Program) RunIntoWriter(
-	ctx context.Context,
-	parsedLayers map[string]*layers.ParsedParameterLayer,
-	ps map[string]interface{},
-	w io.Writer) error {
+// CommandRunner abstracts the actual execution of an *exec.Cmd, so that
+// Runner can be exercised in tests without spawning real subprocesses.
+type CommandRunner interface {
+	Run(cmd *exec.Cmd) error
+}
+
+// execCommandRunner is the default CommandRunner, delegating straight to
+// exec.Cmd.Run.
+type execCommandRunner struct{}
+
+func (execCommandRunner) Run(cmd *exec.Cmd) error {
+	return cmd.Run()
+}
+
+// Runner executes Programs, optionally sandboxing them in an isolated
+// working directory backed by an afero.Fs. The zero value is not usable;
+// construct one with NewRunner.
+type Runner struct {
+	fs        afero.Fs
+	cmdRunner CommandRunner
+}
+
+// RunnerOption configures a Runner constructed with NewRunner.
+type RunnerOption func(*Runner)
+
+// WithFs overrides the afero.Fs used to materialize sandboxed working
+// directories. This is the hook tests use to run entirely against
+// afero.NewMemMapFs() instead of the host filesystem.
+func WithFs(fs afero.Fs) RunnerOption {
+	return func(r *Runner) {
+		r.fs = fs
+	}
+}
+
+// WithCommandRunner overrides how Runner actually executes the prepared
+// *exec.Cmd, which combined with WithFs makes it possible to test Runner
+// end-to-end without spawning real subprocesses.
+func WithCommandRunner(cmdRunner CommandRunner) RunnerOption {
+	return func(r *Runner) {
+		r.cmdRunner = cmdRunner
+	}
+}
+
+func NewRunner(options ...RunnerOption) *Runner {
+	r := &Runner{
+		fs:        afero.NewOsFs(),
+		cmdRunner: execCommandRunner{},
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// Start resolves p's executable and arguments and prepares an *exec.Cmd for
+// it, wiring up Sandbox when p.Sandbox is set. It does not set Stdout/Stderr
+// or execute the command; callers configure those and then hand the command
+// to r.cmdRunner.Run. The returned afero.Fs is rooted at the sandbox's
+// working directory, or nil if p isn't sandboxed.
+func (r *Runner) Start(ctx context.Context, p *Program, ps map[string]interface{}) (*exec.Cmd, afero.Fs, error) {
 	var err error
 	path := p.Path
 	if path == "" {
 		path, err = exec.LookPath(p.Name)
 		if err != nil {
-			return errors.Wrapf(err, "could not find executable %s", p.Name)
+			return nil, nil, errors.Wrapf(err, "could not find executable %s", p.Name)
 		}
 	}
 
-	args, err2 := p.ComputeArgs(ps)
-	if err2 != nil {
-		return err2
+	args, err := p.ComputeArgs(ps)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	cmd := exec.CommandContext(ctx, path, args...)
-	cmd.Env = []string{}
-	// copy current environment
-	cmd.Env = append(cmd.Env, os.Environ()...)
+
+	var sandboxFs afero.Fs
+	if p.Sandbox != nil {
+		workdir, fs_, err := r.materializeSandbox(p.Sandbox)
+		if err != nil {
+			return nil, nil, err
+		}
+		cmd.Dir = workdir
+		sandboxFs = fs_
+		cmd.Env = allowlistedEnv(p.Sandbox.Env)
+	} else {
+		cmd.Env = append([]string{}, os.Environ()...)
+	}
+
 	for k, v := range p.Env {
 		cmd.Env = append(cmd.Env, k+"="+v)
 	}
@@ -191,13 +283,113 @@ func (p *Program) RunIntoWriter(
 	if p.Stdin != "" {
 		cmd.Stdin = strings.NewReader(p.Stdin)
 	}
+
+	return cmd, sandboxFs, nil
+}
+
+// materializeSandbox creates a fresh temporary directory on r.fs and
+// populates it with sb.InputFiles and sb.Mounts, returning both the path
+// (for cmd.Dir, which needs a real filesystem path) and an afero.Fs rooted
+// at that directory so callers can enumerate produced files afterwards.
+func (r *Runner) materializeSandbox(sb *Sandbox) (string, afero.Fs, error) {
+	workdir, err := afero.TempDir(r.fs, "", sb.Workdir)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "could not create sandbox working directory")
+	}
+
+	for name, content := range sb.InputFiles {
+		if err := writeSandboxFile(r.fs, workdir, name, []byte(content)); err != nil {
+			return "", nil, err
+		}
+	}
+
+	for name, hostPath := range sb.Mounts {
+		content, err := os.ReadFile(hostPath)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "could not read mount %s", hostPath)
+		}
+		if err := writeSandboxFile(r.fs, workdir, name, content); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return workdir, afero.NewBasePathFs(r.fs, workdir), nil
+}
+
+// writeSandboxFile writes content to name, resolved relative to workdir. It
+// refuses to write outside of workdir, so that a Sandbox.InputFiles or
+// Sandbox.Mounts key like "../../etc/cron.d/evil" can't escape the sandbox.
+func writeSandboxFile(fs afero.Fs, workdir string, name string, content []byte) error {
+	workdir = filepath.Clean(workdir)
+	fullPath := filepath.Clean(filepath.Join(workdir, name))
+	if fullPath != workdir && !strings.HasPrefix(fullPath, workdir+string(filepath.Separator)) {
+		return errors.Errorf("sandbox file %q escapes the sandbox working directory", name)
+	}
+
+	if err := fs.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return errors.Wrapf(err, "could not create directory for sandbox file %s", name)
+	}
+	if err := afero.WriteFile(fs, fullPath, content, 0644); err != nil {
+		return errors.Wrapf(err, "could not write sandbox file %s", name)
+	}
+	return nil
+}
+
+// allowlistedEnv returns the subset of the host's os.Environ() whose
+// variable names appear in allowlist.
+func allowlistedEnv(allowlist []string) []string {
+	allowed := make(map[string]bool, len(allowlist))
+	for _, name := range allowlist {
+		allowed[name] = true
+	}
+
+	env := []string{}
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if allowed[name] {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// RunIntoWriter runs p, sandboxing it in an isolated working directory when
+// p.Sandbox is set, and returns the afero.Fs rooted at that working
+// directory (or nil, if p isn't sandboxed) so that callers can enumerate
+// files the process produced.
+func (r *Runner) RunIntoWriter(
+	ctx context.Context,
+	p *Program,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	w io.Writer,
+) (afero.Fs, error) {
+	cmd, sandboxFs, err := r.Start(ctx, p, ps)
+	if err != nil {
+		return nil, err
+	}
+
 	cmd.Stdout = w
 	cmd.Stderr = w
-	if err := cmd.Run(); err != nil {
-		return errors.Wrapf(err, "could not run %s", p.Name)
+
+	if err := r.cmdRunner.Run(cmd); err != nil {
+		return sandboxFs, errors.Wrapf(err, "could not run %s", p.Name)
 	}
 
-	return nil
+	return sandboxFs, nil
+}
+
+// RunIntoWriter runs p using a default Runner on the host filesystem. A
+// Program that sets Sandbox is still sandboxed, but the afero.Fs exposing the
+// files the sandboxed run produced is discarded; run such Programs through an
+// explicit Runner to get at it.
+func (p *Program) RunIntoWriter(
+	ctx context.Context,
+	parsedLayers map[string]*layers.ParsedParameterLayer,
+	ps map[string]interface{},
+	w io.Writer) error {
+	_, err := NewRunner().RunIntoWriter(ctx, p, parsedLayers, ps, w)
+	return err
 }
 
 func (p *Program) ComputeArgs(ps map[string]interface{}) ([]string, error) {
@@ -0,0 +1,104 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// fakeCommandRunner is a CommandRunner that never spawns a real process: it
+// just writes canned stdout/stderr and materializes files into cmd.Dir on
+// fs, which is what lets Runner be exercised end-to-end against
+// afero.NewMemMapFs().
+type fakeCommandRunner struct {
+	fs     afero.Fs
+	files  map[string]string
+	stdout string
+	stderr string
+}
+
+func (f *fakeCommandRunner) Run(cmd *exec.Cmd) error {
+	if f.stdout != "" && cmd.Stdout != nil {
+		if _, err := cmd.Stdout.Write([]byte(f.stdout)); err != nil {
+			return err
+		}
+	}
+	if f.stderr != "" && cmd.Stderr != nil {
+		if _, err := cmd.Stderr.Write([]byte(f.stderr)); err != nil {
+			return err
+		}
+	}
+	for name, content := range f.files {
+		if err := afero.WriteFile(f.fs, filepath.Join(cmd.Dir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRunnerSandboxRunsAgainstMemMapFs(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	cmdRunner := &fakeCommandRunner{
+		fs:     memFs,
+		files:  map[string]string{"output.txt": "hello"},
+		stdout: "ran\n",
+	}
+	runner := NewRunner(WithFs(memFs), WithCommandRunner(cmdRunner))
+
+	p := &Program{
+		Name: "fake",
+		Path: "/bin/fake",
+		Sandbox: &Sandbox{
+			InputFiles: map[string]string{"input.txt": "world"},
+		},
+	}
+
+	var out bytes.Buffer
+	sandboxFs, err := runner.RunIntoWriter(context.Background(), p, nil, nil, &out)
+	if err != nil {
+		t.Fatalf("RunIntoWriter returned error: %v", err)
+	}
+	if out.String() != "ran\n" {
+		t.Fatalf("expected captured stdout %q, got %q", "ran\n", out.String())
+	}
+
+	input, err := afero.ReadFile(sandboxFs, "input.txt")
+	if err != nil {
+		t.Fatalf("could not read materialized input file: %v", err)
+	}
+	if string(input) != "world" {
+		t.Fatalf("expected input.txt content %q, got %q", "world", string(input))
+	}
+
+	output, err := afero.ReadFile(sandboxFs, "output.txt")
+	if err != nil {
+		t.Fatalf("could not read produced output file: %v", err)
+	}
+	if string(output) != "hello" {
+		t.Fatalf("expected output.txt content %q, got %q", "hello", string(output))
+	}
+
+	if exists, _ := afero.Exists(afero.NewOsFs(), "output.txt"); exists {
+		t.Fatal("output.txt leaked onto the host filesystem")
+	}
+}
+
+func TestMaterializeSandboxRejectsPathEscape(t *testing.T) {
+	runner := NewRunner(WithFs(afero.NewMemMapFs()))
+
+	p := &Program{
+		Name: "fake",
+		Path: "/bin/fake",
+		Sandbox: &Sandbox{
+			InputFiles: map[string]string{"../../etc/cron.d/evil": "evil"},
+		},
+	}
+
+	if _, _, err := runner.Start(context.Background(), p, nil); err == nil {
+		t.Fatal("expected Start to reject an input file path escaping the sandbox")
+	}
+}
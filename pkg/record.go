@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RecordOptions configures RecordProgram.
+type RecordOptions struct {
+	// Name overrides the recorded Program's Name. If empty, the base name of
+	// the recorded executable is used instead.
+	Name string
+	// OutputDirectory, if set, is snapshotted after the command runs and its
+	// contents stored as the recorded Program's ExpectedFiles.
+	OutputDirectory string
+}
+
+// RecordProgram runs argv as a subprocess and captures it as a Program: the
+// executable into Name/Path, leading non-flag tokens into Verbs, everything
+// else into RawFlags, piped stdin into Stdin, and the observed
+// stdout/stderr/exit code into ExpectedStdout/ExpectedError/ExpectedStatusCode.
+// If opts.OutputDirectory is set, its contents after the run are snapshotted
+// into ExpectedFiles.
+//
+// The resulting Program is meant to be marshalled to YAML, added to a
+// repository, and re-run by the golden-test runner (see RunProgramAsTest).
+func RecordProgram(ctx context.Context, argv []string, opts RecordOptions) (*Program, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("record: no command given")
+	}
+
+	execPath := argv[0]
+	rest := argv[1:]
+
+	program := &Program{
+		Name: filepath.Base(execPath),
+		Path: execPath,
+	}
+	if opts.Name != "" {
+		program.Name = opts.Name
+	}
+
+	i := 0
+	for ; i < len(rest); i++ {
+		if strings.HasPrefix(rest[i], "-") {
+			break
+		}
+		program.Verbs = append(program.Verbs, rest[i])
+	}
+	program.RawFlags = rest[i:]
+
+	cmd := exec.CommandContext(ctx, execPath, rest...)
+
+	if fi, err := os.Stdin.Stat(); err == nil && (fi.Mode()&os.ModeCharDevice) == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read stdin")
+		}
+		program.Stdin = string(data)
+		cmd.Stdin = bytes.NewReader(data)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	statusCode := 0
+	if runErr := cmd.Run(); runErr != nil {
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) {
+			statusCode = exitErr.ExitCode()
+		} else {
+			return nil, errors.Wrapf(runErr, "could not run %s", execPath)
+		}
+	}
+
+	program.ExpectedStdout = stdout.String()
+	program.ExpectedError = stderr.String()
+	program.ExpectedStatusCode = statusCode
+
+	if opts.OutputDirectory != "" {
+		files, err := snapshotFiles(opts.OutputDirectory)
+		if err != nil {
+			return nil, err
+		}
+		program.ExpectedFiles = files
+	}
+
+	return program, nil
+}
+
+// snapshotFiles reads every file under dir into a map keyed by its path
+// relative to dir, suitable for Program.ExpectedFiles.
+func snapshotFiles(dir string) (map[string]string, error) {
+	files := map[string]string{}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		files[rel] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not snapshot output directory %s", dir)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordProgramSplitsVerbsAndRawFlags(t *testing.T) {
+	program, err := RecordProgram(context.Background(), []string{"/bin/echo", "hello", "-n"}, RecordOptions{})
+	if err != nil {
+		t.Fatalf("RecordProgram returned error: %v", err)
+	}
+
+	if program.Name != "echo" {
+		t.Fatalf("expected Name %q, got %q", "echo", program.Name)
+	}
+	if program.Path != "/bin/echo" {
+		t.Fatalf("expected Path %q, got %q", "/bin/echo", program.Path)
+	}
+	if len(program.Verbs) != 1 || program.Verbs[0] != "hello" {
+		t.Fatalf("expected Verbs [hello], got %v", program.Verbs)
+	}
+	if len(program.RawFlags) != 1 || program.RawFlags[0] != "-n" {
+		t.Fatalf("expected RawFlags [-n], got %v", program.RawFlags)
+	}
+	if program.ExpectedStatusCode != 0 {
+		t.Fatalf("expected status code 0, got %d", program.ExpectedStatusCode)
+	}
+}
+
+func TestRecordProgramCapturesNonZeroExitCode(t *testing.T) {
+	program, err := RecordProgram(context.Background(), []string{"/bin/false"}, RecordOptions{})
+	if err != nil {
+		t.Fatalf("RecordProgram returned error: %v", err)
+	}
+	if program.ExpectedStatusCode != 1 {
+		t.Fatalf("expected status code 1, got %d", program.ExpectedStatusCode)
+	}
+}
+
+func TestRecordProgramOverridesName(t *testing.T) {
+	program, err := RecordProgram(context.Background(), []string{"/bin/echo"}, RecordOptions{Name: "greet"})
+	if err != nil {
+		t.Fatalf("RecordProgram returned error: %v", err)
+	}
+	if program.Name != "greet" {
+		t.Fatalf("expected Name %q, got %q", "greet", program.Name)
+	}
+}
+
+func TestRecordProgramSnapshotsOutputDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "out.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("could not seed output file: %v", err)
+	}
+
+	program, err := RecordProgram(context.Background(), []string{"/bin/echo"}, RecordOptions{OutputDirectory: dir})
+	if err != nil {
+		t.Fatalf("RecordProgram returned error: %v", err)
+	}
+
+	if got := program.ExpectedFiles["out.txt"]; got != "hello" {
+		t.Fatalf("expected ExpectedFiles[out.txt] %q, got %q", "hello", got)
+	}
+}
+
+func TestSnapshotFilesReadsNestedFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "nested"), 0755); err != nil {
+		t.Fatalf("could not create nested dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "nested", "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("could not seed nested file: %v", err)
+	}
+
+	files, err := snapshotFiles(dir)
+	if err != nil {
+		t.Fatalf("snapshotFiles returned error: %v", err)
+	}
+
+	if got := files[filepath.Join("nested", "file.txt")]; got != "content" {
+		t.Fatalf("expected nested file content %q, got %q", "content", got)
+	}
+}
@@ -0,0 +1,165 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/afero"
+)
+
+// FileTestResult describes the outcome of comparing a single entry of
+// Program.ExpectedFiles against the file that was actually produced by the
+// run.
+type FileTestResult struct {
+	Path   string `yaml:"path"`
+	Passed bool   `yaml:"passed"`
+	// Actual is the content that was actually produced, read back from the
+	// run's working directory. It is populated whenever the file could be
+	// read, regardless of whether it matched, so that --update can rewrite
+	// Program.ExpectedFiles from it.
+	Actual string `yaml:"actual,omitempty"`
+	Diff   string `yaml:"diff,omitempty"`
+	Error  string `yaml:"error,omitempty"`
+}
+
+// TestResult is the outcome of running a single Program through
+// RunProgramAsTest and comparing its behaviour against the Expected* fields
+// it carries.
+//
+// It is meant to be emitted as a glazed row (see cmds.NewTestCommand), which
+// is why its fields other than Files are kept flat and string/bool/int typed;
+// Files is a slice of per-file results that the test command renders into a
+// single string column.
+type TestResult struct {
+	Name       string           `yaml:"name"`
+	Passed     bool             `yaml:"passed"`
+	StatusCode int              `yaml:"statusCode"`
+	Stdout     string           `yaml:"stdout,omitempty"`
+	Stderr     string           `yaml:"stderr,omitempty"`
+	StdoutDiff string           `yaml:"stdoutDiff,omitempty"`
+	StderrDiff string           `yaml:"stderrDiff,omitempty"`
+	Files      []FileTestResult `yaml:"files,omitempty"`
+	Error      string           `yaml:"error,omitempty"`
+}
+
+// RunProgramAsTest runs p through runner, except that it keeps stdout and
+// stderr separate, always collects the exit code (even when the process
+// fails), and compares the resulting behaviour against p.ExpectedStdout,
+// p.ExpectedError, p.ExpectedStatusCode and p.ExpectedFiles.
+//
+// runner may be nil, in which case a default Runner (host filesystem, real
+// subprocesses) is used.
+// Passing an explicit Runner built with WithFs(afero.NewMemMapFs()) and
+// WithCommandRunner is how callers (and tests) exercise this end-to-end
+// without spawning real subprocesses or touching the host filesystem.
+//
+// If p.Sandbox is unset, a temporary working directory is still created (so
+// that ExpectedFiles can be resolved without touching the caller's current
+// directory), but the process keeps its full environment rather than being
+// restricted to a Sandbox.Env allowlist.
+func RunProgramAsTest(ctx context.Context, runner *Runner, p *Program, ps map[string]interface{}) (*TestResult, error) {
+	if runner == nil {
+		runner = NewRunner()
+	}
+
+	cmd, sandboxFs, err := runner.Start(ctx, p, ps)
+	if err != nil {
+		return nil, err
+	}
+
+	if sandboxFs == nil {
+		workdir, err := afero.TempDir(runner.fs, "", "cliopatra-test-")
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create temporary working directory")
+		}
+		defer func() {
+			_ = runner.fs.RemoveAll(workdir)
+		}()
+
+		cmd.Dir = workdir
+		sandboxFs = afero.NewBasePathFs(runner.fs, workdir)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	statusCode := 0
+	runErr := runner.cmdRunner.Run(cmd)
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) {
+			statusCode = exitErr.ExitCode()
+		} else {
+			return nil, errors.Wrapf(runErr, "could not run %s", p.Name)
+		}
+	}
+
+	result := &TestResult{
+		Name:       p.Name,
+		StatusCode: statusCode,
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+		Passed:     true,
+	}
+
+	if p.ExpectedStatusCode != statusCode {
+		result.Passed = false
+	}
+
+	if diff := unifiedDiff("stdout", p.ExpectedStdout, stdout.String()); diff != "" {
+		result.Passed = false
+		result.StdoutDiff = diff
+	}
+
+	if diff := unifiedDiff("stderr", p.ExpectedError, stderr.String()); diff != "" {
+		result.Passed = false
+		result.StderrDiff = diff
+	}
+
+	for name, expected := range p.ExpectedFiles {
+		fileResult := FileTestResult{Path: name, Passed: true}
+
+		content, err := afero.ReadFile(sandboxFs, name)
+		if err != nil {
+			fileResult.Passed = false
+			fileResult.Error = err.Error()
+		} else {
+			fileResult.Actual = string(content)
+			if diff := unifiedDiff(name, expected, string(content)); diff != "" {
+				fileResult.Passed = false
+				fileResult.Diff = diff
+			}
+		}
+
+		if !fileResult.Passed {
+			result.Passed = false
+		}
+		result.Files = append(result.Files, fileResult)
+	}
+
+	return result, nil
+}
+
+// unifiedDiff returns a unified diff between expected and actual, or the
+// empty string if they are identical. An empty expected value is treated as
+// "no expectation set" and never produces a diff.
+func unifiedDiff(name, expected, actual string) string {
+	if expected == "" || expected == actual {
+		return ""
+	}
+
+	diff := difflib.UnifiedDiff{
+		A:        difflib.SplitLines(expected),
+		B:        difflib.SplitLines(actual),
+		FromFile: fmt.Sprintf("%s (expected)", name),
+		ToFile:   fmt.Sprintf("%s (actual)", name),
+		Context:  3,
+	}
+	text, _ := difflib.GetUnifiedDiffString(diff)
+	return text
+}
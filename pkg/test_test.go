@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestRunProgramAsTestReportsFileMismatch(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	cmdRunner := &fakeCommandRunner{
+		fs:    memFs,
+		files: map[string]string{"greeting.txt": "hello world"},
+	}
+	runner := NewRunner(WithFs(memFs), WithCommandRunner(cmdRunner))
+
+	p := &Program{
+		Name:    "fake",
+		Path:    "/bin/fake",
+		Sandbox: &Sandbox{},
+		ExpectedFiles: map[string]string{
+			"greeting.txt": "hello there",
+		},
+	}
+
+	result, err := RunProgramAsTest(context.Background(), runner, p, nil)
+	if err != nil {
+		t.Fatalf("RunProgramAsTest returned error: %v", err)
+	}
+	if result.Passed {
+		t.Fatal("expected result to fail on file mismatch")
+	}
+	if len(result.Files) != 1 {
+		t.Fatalf("expected 1 file result, got %d", len(result.Files))
+	}
+	if result.Files[0].Actual != "hello world" {
+		t.Fatalf("expected actual content %q, got %q", "hello world", result.Files[0].Actual)
+	}
+	if result.Files[0].Diff == "" {
+		t.Fatal("expected a diff to be rendered for the mismatching file")
+	}
+}
+
+func TestRunProgramAsTestPassesOnMatch(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	cmdRunner := &fakeCommandRunner{
+		fs:     memFs,
+		stdout: "hello world\n",
+	}
+	runner := NewRunner(WithFs(memFs), WithCommandRunner(cmdRunner))
+
+	p := &Program{
+		Name:           "fake",
+		Path:           "/bin/fake",
+		Sandbox:        &Sandbox{},
+		ExpectedStdout: "hello world\n",
+	}
+
+	result, err := RunProgramAsTest(context.Background(), runner, p, nil)
+	if err != nil {
+		t.Fatalf("RunProgramAsTest returned error: %v", err)
+	}
+	if !result.Passed {
+		t.Fatalf("expected result to pass, got diff: %s", result.StdoutDiff)
+	}
+}